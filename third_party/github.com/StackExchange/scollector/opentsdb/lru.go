@@ -0,0 +1,96 @@
+package opentsdb
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a thread-safe, fixed-size, TTL-expiring cache of (value, error)
+// pairs keyed by string. It backs Cache's query result and lookup stores.
+type lru struct {
+	opts CacheOptions
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits, misses, evictions int64
+}
+
+type lruEntry struct {
+	key     string
+	val     interface{}
+	err     error
+	expires time.Time
+}
+
+func newLRU(opts CacheOptions) *lru {
+	return &lru{
+		opts:  opts,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value and error for key, and whether it was found
+// and not expired.
+func (l *lru) get(key string) (interface{}, error, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.items[key]
+	if !ok {
+		l.misses++
+		return nil, nil, false
+	}
+	en := e.Value.(*lruEntry)
+	if time.Now().After(en.expires) {
+		l.ll.Remove(e)
+		delete(l.items, key)
+		l.misses++
+		l.evictions++
+		return nil, nil, false
+	}
+	l.ll.MoveToFront(e)
+	l.hits++
+	return en.val, en.err, true
+}
+
+// set stores val/err under key, evicting the least recently used entry if
+// this insert would exceed MaxEntries. err results use NegativeTTL.
+func (l *lru) set(key string, val interface{}, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ttl := l.opts.TTL
+	if err != nil {
+		ttl = l.opts.NegativeTTL
+	}
+	expires := time.Now().Add(ttl)
+	if e, ok := l.items[key]; ok {
+		en := e.Value.(*lruEntry)
+		en.val, en.err, en.expires = val, err, expires
+		l.ll.MoveToFront(e)
+		return
+	}
+	e := l.ll.PushFront(&lruEntry{key: key, val: val, err: err, expires: expires})
+	l.items[key] = e
+	if l.ll.Len() > l.opts.MaxEntries {
+		l.removeOldest()
+	}
+}
+
+func (l *lru) removeOldest() {
+	e := l.ll.Back()
+	if e == nil {
+		return
+	}
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*lruEntry).key)
+	l.evictions++
+}
+
+func (l *lru) stats() (hits, misses, evictions, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.hits, l.misses, l.evictions, int64(l.ll.Len())
+}
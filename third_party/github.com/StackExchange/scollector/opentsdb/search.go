@@ -0,0 +1,166 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// TSMeta is a single time series as returned by /api/search/lookup.
+type TSMeta struct {
+	TSUID  string `json:"tsuid"`
+	Metric string `json:"metric"`
+	Tags   TagSet `json:"tags"`
+}
+
+// lookupResponse is the body of an /api/search/lookup response.
+type lookupResponse struct {
+	Type    string   `json:"type"`
+	Metric  string   `json:"metric"`
+	Tags    []TagSet `json:"tags"`
+	Limit   int      `json:"limit"`
+	Time    float64  `json:"time"`
+	Results []TSMeta `json:"results"`
+}
+
+// SuggestMetrics returns up to max metric names starting with prefix, via
+// /api/suggest?type=metrics. A max <= 0 uses the server's default.
+func (h Host) SuggestMetrics(prefix string, max int) ([]string, error) {
+	return h.suggest("metrics", prefix, max)
+}
+
+// SuggestTagKeys returns up to max tag keys starting with prefix, via
+// /api/suggest?type=tagk. A max <= 0 uses the server's default.
+func (h Host) SuggestTagKeys(prefix string, max int) ([]string, error) {
+	return h.suggest("tagk", prefix, max)
+}
+
+// SuggestTagValues returns up to max tag values starting with prefix, via
+// /api/suggest?type=tagv. A max <= 0 uses the server's default.
+func (h Host) SuggestTagValues(prefix string, max int) ([]string, error) {
+	return h.suggest("tagv", prefix, max)
+}
+
+func (h Host) suggest(typ, prefix string, max int) ([]string, error) {
+	v := url.Values{}
+	v.Set("type", typ)
+	v.Set("q", prefix)
+	if max > 0 {
+		v.Set("max", strconv.Itoa(max))
+	}
+	u := url.URL{
+		Scheme:   "http",
+		Host:     string(h),
+		Path:     "/api/suggest",
+		RawQuery: v.Encode(),
+	}
+	var out []string
+	if err := getJSON(u.String(), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Lookup returns the time series matching metric and tags via
+// /api/search/lookup. metric and the keys/values of tags are run through
+// Clean before being sent upstream. A nil or empty tags matches all tags for
+// metric.
+func (h Host) Lookup(metric string, tags TagSet) ([]TSMeta, error) {
+	m, err := Clean(metric)
+	if err != nil {
+		return nil, err
+	}
+	ct := make(TagSet, len(tags))
+	for k, v := range tags {
+		ck, err := Clean(k)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := Clean(v)
+		if err != nil {
+			return nil, err
+		}
+		ct[ck] = cv
+	}
+	q := m
+	if len(ct) > 0 {
+		q += "{" + ct.Tags() + "}"
+	}
+	v := url.Values{}
+	v.Set("m", q)
+	u := url.URL{
+		Scheme:   "http",
+		Host:     string(h),
+		Path:     "/api/search/lookup",
+		RawQuery: v.Encode(),
+	}
+	var lr lookupResponse
+	if err := getJSON(u.String(), &lr); err != nil {
+		return nil, err
+	}
+	return lr.Results, nil
+}
+
+// getJSON performs an HTTP GET against u and unmarshals the body into out,
+// returning a RequestError if the server responded with a non-200 status
+// and an OpenTSDB-style error body.
+func getJSON(u string, out interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := RequestError{Request: u}
+		if err := json.Unmarshal(b, &e); err == nil {
+			return &e
+		}
+		return fmt.Errorf("tsdb: %s", b)
+	}
+	return json.Unmarshal(b, out)
+}
+
+// SuggestMetrics mirrors Host.SuggestMetrics against the Cache's host.
+func (c *Cache) SuggestMetrics(prefix string, max int) ([]string, error) {
+	return Host(c.host).SuggestMetrics(prefix, max)
+}
+
+// SuggestTagKeys mirrors Host.SuggestTagKeys against the Cache's host.
+func (c *Cache) SuggestTagKeys(prefix string, max int) ([]string, error) {
+	return Host(c.host).SuggestTagKeys(prefix, max)
+}
+
+// SuggestTagValues mirrors Host.SuggestTagValues against the Cache's host.
+func (c *Cache) SuggestTagValues(prefix string, max int) ([]string, error) {
+	return Host(c.host).SuggestTagValues(prefix, max)
+}
+
+// Lookup mirrors Host.Lookup against the Cache's host, caching results keyed
+// on the marshaled metric and tags.
+func (c *Cache) Lookup(metric string, tags TagSet) ([]TSMeta, error) {
+	b, err := json.Marshal(struct {
+		Metric string
+		Tags   TagSet
+	}{metric, tags})
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+
+	if v, e, ok := c.lookups.get(s); ok {
+		tsm, _ := v.([]TSMeta)
+		return tsm, e
+	}
+
+	tsm, err := Host(c.host).Lookup(metric, tags)
+	c.lookups.set(s, tsm, err)
+
+	return tsm, err
+}
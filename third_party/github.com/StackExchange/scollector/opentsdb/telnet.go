@@ -0,0 +1,283 @@
+package opentsdb
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StackExchange/tsaf/third_party/github.com/StackExchange/slog"
+)
+
+// Defaults for TelnetOptions.
+const (
+	DefaultTelnetPort      = 4242
+	DefaultMaxBatchPoints  = 100
+	DefaultMaxBatchLatency = 2 * time.Second
+	DefaultWriteTimeout    = 5 * time.Second
+	DefaultMaxBackoff      = 30 * time.Second
+)
+
+// TelnetOptions configures a TelnetSender.
+type TelnetOptions struct {
+	// Conns is the number of persistent connections to shard writes across.
+	// Defaults to 1.
+	Conns int
+	// MaxBatchPoints is the most DataPoints buffered on a connection before
+	// a flush is forced. Defaults to DefaultMaxBatchPoints.
+	MaxBatchPoints int
+	// MaxBatchLatency is the longest a DataPoint waits in a batch before
+	// being flushed. Defaults to DefaultMaxBatchLatency.
+	MaxBatchLatency time.Duration
+	// WriteTimeout bounds dials and writes to the tsd. Defaults to
+	// DefaultWriteTimeout.
+	WriteTimeout time.Duration
+	// MaxBackoff bounds the exponential backoff applied between reconnect
+	// attempts after a write failure. Defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+func (o *TelnetOptions) setDefaults() {
+	if o.Conns < 1 {
+		o.Conns = 1
+	}
+	if o.MaxBatchPoints < 1 {
+		o.MaxBatchPoints = DefaultMaxBatchPoints
+	}
+	if o.MaxBatchLatency <= 0 {
+		o.MaxBatchLatency = DefaultMaxBatchLatency
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = DefaultWriteTimeout
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+}
+
+// TelnetSender writes DataPoints to an OpenTSDB tsd's telnet `put` port over
+// a pool of long-lived TCP connections. Writes are sharded across the pool
+// by a stable hash of metric+tags, batched, and flushed either once a batch
+// fills or MaxBatchLatency elapses, whichever comes first. It is a
+// higher-throughput alternative to the per-request HTTP POST made by
+// Request.Query, for high-volume ingest paths.
+type TelnetSender struct {
+	conns []*telnetConn
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	sent       int64
+	dropped    int64
+	reconnects int64
+}
+
+// NewTelnetSender starts a TelnetSender against host, which should be of the
+// form hostname:port. If host has no port, DefaultTelnetPort is assumed.
+func NewTelnetSender(host string, opts TelnetOptions) *TelnetSender {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = fmt.Sprintf("%s:%d", host, DefaultTelnetPort)
+	}
+	opts.setDefaults()
+	t := &TelnetSender{
+		closing: make(chan struct{}),
+		conns:   make([]*telnetConn, opts.Conns),
+	}
+	for i := range t.conns {
+		c := &telnetConn{
+			host:       host,
+			opts:       opts,
+			in:         make(chan *DataPoint, opts.MaxBatchPoints*4),
+			sent:       &t.sent,
+			dropped:    &t.dropped,
+			reconnects: &t.reconnects,
+		}
+		t.conns[i] = c
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			c.run(t.closing)
+		}()
+	}
+	return t
+}
+
+// Send enqueues every DataPoint in m for delivery. It does not block on the
+// network; points are dropped (and counted in Stats) if the sender has been
+// closed, if a shard's queue is full, or if its connection cannot be
+// (re)established.
+func (t *TelnetSender) Send(m MultiDataPoint) {
+	select {
+	case <-t.closing:
+		atomic.AddInt64(&t.dropped, int64(len(m)))
+		return
+	default:
+	}
+	for _, d := range m {
+		c := t.conns[t.shard(d)]
+		select {
+		case c.in <- d:
+		default:
+			atomic.AddInt64(&t.dropped, 1)
+		}
+	}
+}
+
+// shard picks a connection index for d via a stable hash of its metric and
+// tags, so repeated writes of the same series land on the same connection.
+func (t *TelnetSender) shard(d *DataPoint) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s%s", d.Metric, d.Tags.Tags())
+	return int(h.Sum32() % uint32(len(t.conns)))
+}
+
+// Stats returns running totals of points sent, points dropped, and
+// reconnects across the whole pool.
+func (t *TelnetSender) Stats() (sent, dropped, reconnects int64) {
+	return atomic.LoadInt64(&t.sent), atomic.LoadInt64(&t.dropped), atomic.LoadInt64(&t.reconnects)
+}
+
+// Close stops accepting new points, flushes any pending batches, and closes
+// every connection in the pool.
+func (t *TelnetSender) Close() {
+	close(t.closing)
+	t.wg.Wait()
+}
+
+// telnetConn owns a single connection's batch and retry state. It is only
+// ever touched by its own run goroutine, except for the shared counters.
+type telnetConn struct {
+	host string
+	opts TelnetOptions
+
+	in chan *DataPoint
+
+	conn net.Conn
+	w    *bufio.Writer
+
+	backoff      time.Duration
+	nextDial     time.Time
+	reconnecting bool
+
+	sent       *int64
+	dropped    *int64
+	reconnects *int64
+}
+
+func (c *telnetConn) run(closing chan struct{}) {
+	ticker := time.NewTicker(c.opts.MaxBatchLatency)
+	defer ticker.Stop()
+	var batch []*DataPoint
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c.write(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case d := <-c.in:
+			batch = append(batch, d)
+			if len(batch) >= c.opts.MaxBatchPoints {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-closing:
+			for {
+				select {
+				case d := <-c.in:
+					batch = append(batch, d)
+					continue
+				default:
+				}
+				break
+			}
+			flush()
+			if c.conn != nil {
+				c.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (c *telnetConn) write(batch []*DataPoint) {
+	if err := c.ensureConn(); err != nil {
+		atomic.AddInt64(c.dropped, int64(len(batch)))
+		slog.Infoln("tsdb: telnet:", err)
+		return
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	for _, d := range batch {
+		if _, err := c.w.WriteString(d.Telnet()); err != nil {
+			atomic.AddInt64(c.dropped, int64(len(batch)))
+			c.reconnect()
+			return
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		atomic.AddInt64(c.dropped, int64(len(batch)))
+		c.reconnect()
+		return
+	}
+	atomic.AddInt64(c.sent, int64(len(batch)))
+}
+
+// ensureConn dials a new connection if one isn't already open, respecting
+// the backoff set by the last failed attempt. A successful dial that
+// follows a reconnect() (as opposed to the pool's initial connect) is
+// counted in reconnects.
+func (c *telnetConn) ensureConn() error {
+	if c.conn != nil {
+		return nil
+	}
+	if now := time.Now(); now.Before(c.nextDial) {
+		return fmt.Errorf("tsdb: %s: backing off until %s", c.host, c.nextDial)
+	}
+	conn, err := net.DialTimeout("tcp", c.host, c.opts.WriteTimeout)
+	if err != nil {
+		c.armBackoff()
+		return err
+	}
+	if c.reconnecting {
+		atomic.AddInt64(c.reconnects, 1)
+		c.reconnecting = false
+	}
+	c.backoff = 0
+	c.conn = conn
+	c.w = bufio.NewWriter(conn)
+	return nil
+}
+
+// armBackoff advances the exponential backoff applied before the next dial
+// attempt, capped at MaxBackoff.
+func (c *telnetConn) armBackoff() {
+	if c.backoff == 0 {
+		c.backoff = time.Second
+	} else {
+		c.backoff *= 2
+	}
+	if c.backoff > c.opts.MaxBackoff {
+		c.backoff = c.opts.MaxBackoff
+	}
+	c.nextDial = time.Now().Add(c.backoff)
+}
+
+// reconnect tears down the current connection after a write failure and
+// arms the backoff so the next ensureConn doesn't immediately redial a
+// peer that is failing writes (e.g. a half-open connection reset on
+// write) without any delay.
+func (c *telnetConn) reconnect() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.w = nil
+	c.reconnecting = true
+	c.armBackoff()
+}
@@ -2,6 +2,7 @@ package opentsdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 	"unicode/utf8"
@@ -335,10 +337,16 @@ func (r Request) String() string {
 }
 
 // ParseAbsTime returns the time of s, which must be of any non-relative (not
-// "X-ago") format supported by OpenTSDB.
-func ParseAbsTime(s string) (time.Time, error) {
+// "X-ago") format supported by OpenTSDB: the four "2006/01/02..." layouts,
+// RFC3339 (with or without fractional seconds), or a Unix epoch. msResolution
+// is optional (variadic only to keep existing single-argument callers
+// working); when set true, a bare integer epoch is interpreted as
+// milliseconds instead of seconds, matching Request.MsResolution.
+func ParseAbsTime(s string, msResolution ...bool) (time.Time, error) {
 	var t time.Time
-	t_formats := [4]string{
+	t_formats := [6]string{
+		time.RFC3339Nano,
+		time.RFC3339,
 		"2006/01/02-15:04:05",
 		"2006/01/02-15:04",
 		"2006/01/02-15",
@@ -353,55 +361,118 @@ func ParseAbsTime(s string) (time.Time, error) {
 	if err != nil {
 		return t, err
 	}
-	return time.Unix(i, 0), nil
+	return epochToTime(i, len(msResolution) > 0 && msResolution[0]), nil
+}
+
+// epochToTime returns the time for the Unix epoch i, interpreting it as
+// milliseconds if msResolution is true and as seconds otherwise.
+func epochToTime(i int64, msResolution bool) time.Time {
+	if msResolution {
+		return time.Unix(0, i*int64(time.Millisecond))
+	}
+	return time.Unix(i, 0)
+}
+
+// calendarRE matches the OpenTSDB relative calendar units ParseDuration does
+// not understand: weeks, months ("mo", to disambiguate from minutes), and
+// years.
+var calendarRE = regexp.MustCompile(`^(\d+)(w|mo|y)$`)
+
+// calendarAgo returns now shifted back by the calendar-unit duration s (for
+// example "2w", "3mo", "1y"), and whether s was recognized as one.
+func calendarAgo(now time.Time, s string) (time.Time, bool) {
+	m := calendarRE.FindStringSubmatch(s)
+	if m == nil {
+		return now, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return now, false
+	}
+	switch m[2] {
+	case "w":
+		return now.AddDate(0, 0, -7*n), true
+	case "mo":
+		return now.AddDate(0, -n, 0), true
+	case "y":
+		return now.AddDate(-n, 0, 0), true
+	}
+	return now, false
 }
 
 // ParseTime returns the time of v, which can be of any format supported by
-// OpenTSDB.
-func ParseTime(v interface{}) (time.Time, error) {
+// OpenTSDB: an RFC3339 or "2006/01/02..." string, a "<dur>-ago" relative
+// expression (including week/month/year units, which ParseDuration alone
+// cannot handle), or a Unix epoch as a string or int64. msResolution is
+// optional (variadic only to keep existing single-argument callers
+// working); pass the enclosing Request's MsResolution so a bare int64/numeric
+// epoch is interpreted as milliseconds rather than seconds.
+func ParseTime(v interface{}, msResolution ...bool) (time.Time, error) {
+	ms := len(msResolution) > 0 && msResolution[0]
 	now := time.Now().UTC()
 	switch i := v.(type) {
 	case string:
 		if i != "" {
 			if strings.HasSuffix(i, "-ago") {
 				s := strings.TrimSuffix(i, "-ago")
+				if t, ok := calendarAgo(now, s); ok {
+					return t, nil
+				}
 				d, err := ParseDuration(s)
 				if err != nil {
 					return now, err
 				}
 				return now.Add(time.Duration(-d)), nil
 			} else {
-				return ParseAbsTime(i)
+				return ParseAbsTime(i, ms)
 			}
 		} else {
 			return now, nil
 		}
 	case int64:
-		return time.Unix(i, 0), nil
+		return epochToTime(i, ms), nil
 	default:
 		return time.Time{}, errors.New("type must be string or int64")
 	}
 }
 
+// ParseTimeRange parses start and end, each of any format ParseTime
+// accepts, and returns normalized UTC endpoints. A nil or empty end is
+// treated as now. It is an error for end to be before start. msResolution is
+// optional (variadic only to keep existing two-argument callers working)
+// and is forwarded to ParseTime for both start and end.
+func ParseTimeRange(start, end interface{}, msResolution ...bool) (time.Time, time.Time, error) {
+	ms := len(msResolution) > 0 && msResolution[0]
+	s, err := ParseTime(start, ms)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	var e time.Time
+	if v, ok := end.(string); end == nil || (ok && v == "") {
+		e = time.Now().UTC()
+	} else {
+		e, err = ParseTime(end, ms)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	s, e = s.UTC(), e.UTC()
+	if e.Before(s) {
+		return time.Time{}, time.Time{}, fmt.Errorf("tsdb: end %s is before start %s", e, s)
+	}
+	return s, e, nil
+}
+
 // GetDuration returns the duration from the request's start to end.
 func GetDuration(r *Request) (Duration, error) {
 	var t Duration
 	if v, ok := r.Start.(string); ok && v == "" {
 		return t, errors.New("start time must be provided")
 	}
-	start, err := ParseTime(r.Start)
+	start, end, err := ParseTimeRange(r.Start, r.End, r.MsResolution)
 	if err != nil {
 		return t, err
 	}
-	var end time.Time
-	if r.End != nil {
-		end, err = ParseTime(r.End)
-		if err != nil {
-			return t, err
-		}
-	} else {
-		end = time.Now()
-	}
 	t = Duration(end.Sub(start))
 	return t, nil
 }
@@ -429,6 +500,13 @@ func (r *Request) AutoDownsample(l int64) error {
 // Query performs a v2 OpenTSDB request to the given host. host should be of the
 // form hostname:port. Can return a RequestError.
 func (r Request) Query(host string) (ResponseSet, error) {
+	return r.QueryContext(context.Background(), host)
+}
+
+// QueryContext is like Query, but carries ctx through to the underlying HTTP
+// request, so callers can cancel a long-running OpenTSDB scan or bound it
+// with a deadline.
+func (r Request) QueryContext(ctx context.Context, host string) (ResponseSet, error) {
 	u := url.URL{
 		Scheme: "http",
 		Host:   host,
@@ -438,7 +516,12 @@ func (r Request) Query(host string) (ResponseSet, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.Post(u.String(), "application/json", bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -477,42 +560,155 @@ func (r *RequestError) Error() string {
 
 type Context interface {
 	Query(Request) (ResponseSet, error)
+	QueryContext(context.Context, Request) (ResponseSet, error)
+
+	SuggestMetrics(prefix string, max int) ([]string, error)
+	SuggestTagKeys(prefix string, max int) ([]string, error)
+	SuggestTagValues(prefix string, max int) ([]string, error)
+	Lookup(metric string, tags TagSet) ([]TSMeta, error)
 }
 
 type Host string
 
 func (h Host) Query(r Request) (ResponseSet, error) {
-	return r.Query(string(h))
+	return h.QueryContext(context.Background(), r)
+}
+
+func (h Host) QueryContext(ctx context.Context, r Request) (ResponseSet, error) {
+	return r.QueryContext(ctx, string(h))
 }
 
+// CacheOptions configures a Cache's bounded LRU storage.
+type CacheOptions struct {
+	// MaxEntries caps the number of entries held per cache (query results
+	// and lookups are tracked separately). Defaults to DefaultMaxEntries.
+	MaxEntries int
+	// TTL is how long a successful result is cached. Defaults to DefaultTTL.
+	TTL time.Duration
+	// NegativeTTL is how long an error result is cached; normally shorter
+	// than TTL so a transient upstream failure isn't remembered for long.
+	// Defaults to DefaultNegativeTTL.
+	NegativeTTL time.Duration
+}
+
+// Defaults for CacheOptions.
+const (
+	DefaultMaxEntries  = 10000
+	DefaultTTL         = 5 * time.Minute
+	DefaultNegativeTTL = 30 * time.Second
+)
+
+func (o *CacheOptions) setDefaults() {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = DefaultMaxEntries
+	}
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = DefaultNegativeTTL
+	}
+}
+
+// CacheStats reports a Cache's LRU behavior, aggregated across its query
+// result and lookup stores.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int64
+}
+
+// Cache memoizes Query and Lookup calls against host behind a bounded,
+// TTL-expiring, concurrency-safe LRU.
 type Cache struct {
-	host  string
-	cache map[string]*cacheResult
+	host string
+	opts CacheOptions
+
+	results *lru
+	lookups *lru
+
+	invMu    sync.Mutex
+	inflight map[string]*inflightCall
 }
 
-type cacheResult struct {
-	ResponseSet
-	Err error
+// inflightCall is a singleflight-style in-progress request: the first
+// caller for a given key does the work, and every other caller for that key
+// blocks on wg and shares its result.
+type inflightCall struct {
+	wg  sync.WaitGroup
+	val ResponseSet
+	err error
 }
 
-func NewCache(host string) *Cache {
+// NewCache returns a Cache for host. opts is optional; the zero value (or
+// omitting it, as the pre-existing NewCache(host) callers do) applies
+// DefaultMaxEntries, DefaultTTL, and DefaultNegativeTTL.
+func NewCache(host string, opts ...CacheOptions) *Cache {
+	var o CacheOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	o.setDefaults()
 	return &Cache{
-		host:  host,
-		cache: make(map[string]*cacheResult),
+		host:     host,
+		opts:     o,
+		results:  newLRU(o),
+		lookups:  newLRU(o),
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+// Stats returns hits, misses, evictions, and current size across the
+// Cache's query result and lookup stores.
+func (c *Cache) Stats() CacheStats {
+	rh, rm, re, rs := c.results.stats()
+	lh, lm, le, ls := c.lookups.stats()
+	return CacheStats{
+		Hits:      rh + lh,
+		Misses:    rm + lm,
+		Evictions: re + le,
+		Size:      rs + ls,
 	}
 }
 
 func (c *Cache) Query(r Request) (ResponseSet, error) {
+	return c.QueryContext(context.Background(), r)
+}
+
+func (c *Cache) QueryContext(ctx context.Context, r Request) (ResponseSet, error) {
 	b, err := json.Marshal(&r)
 	if err != nil {
 		return nil, err
 	}
 	s := string(b)
-	if v, ok := c.cache[s]; ok {
-		return v.ResponseSet, v.Err
+
+	if v, e, ok := c.results.get(s); ok {
+		rs, _ := v.(ResponseSet)
+		return rs, e
+	}
+
+	c.invMu.Lock()
+	if call, ok := c.inflight[s]; ok {
+		c.invMu.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
 	}
-	rs, e := r.Query(c.host)
-	c.cache[s] = &cacheResult{rs, e}
+	call := &inflightCall{}
+	call.wg.Add(1)
+	c.inflight[s] = call
+	c.invMu.Unlock()
+
+	rs, e := r.QueryContext(ctx, c.host)
+
+	c.invMu.Lock()
+	call.val, call.err = rs, e
+	delete(c.inflight, s)
+	c.invMu.Unlock()
+	call.wg.Done()
+
+	c.results.set(s, rs, e)
+
 	return rs, e
 }
 
@@ -529,23 +725,18 @@ func NewDateCache(host string, now time.Time) *DateCache {
 }
 
 func (c *DateCache) Query(r Request) (ResponseSet, error) {
-	start, err := ParseTime(r.Start)
+	return c.QueryContext(context.Background(), r)
+}
+
+func (c *DateCache) QueryContext(ctx context.Context, r Request) (ResponseSet, error) {
+	start, end, err := ParseTimeRange(r.Start, r.End, r.MsResolution)
 	if err != nil {
 		return nil, err
 	}
-	var end time.Time
-	if r.End != nil {
-		end, err = ParseTime(r.End)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		end = time.Now()
-	}
 	diff := c.now.Sub(end)
 	start = start.Add(diff)
 	end = end.Add(diff)
 	r.Start = start.Unix()
 	r.End = end.Unix()
-	return c.Cache.Query(r)
+	return c.Cache.QueryContext(ctx, r)
 }
\ No newline at end of file